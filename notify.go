@@ -0,0 +1,144 @@
+package reg
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NotifyFilter selects which kinds of registry changes a call to Notify
+// reports, and whether the whole subtree rooted at the key is watched.
+type NotifyFilter struct {
+	// Change is an OR of CHANGE_NAME, CHANGE_ATTRIBUTES, CHANGE_LAST_SET
+	// and CHANGE_SECURITY.
+	Change uint32
+	// WatchSubtree, if true, reports changes to descendant keys as well
+	// as the key itself.
+	WatchSubtree bool
+}
+
+// Bits for NotifyFilter.Change, matching REG_NOTIFY_CHANGE_* in winreg.h.
+const (
+	CHANGE_NAME       = 0x00000001
+	CHANGE_ATTRIBUTES = 0x00000002
+	CHANGE_LAST_SET   = 0x00000004
+	CHANGE_SECURITY   = 0x00000008
+)
+
+const regNotifyThreadAgnostic = 0x10000000 // REG_NOTIFY_THREAD_AGNOSTIC, Windows 8+
+
+// NotifyEvent is sent on the channel returned by Notify each time a
+// matching change occurs. RegNotifyChangeKeyValue does not report what
+// changed, so callers are expected to re-query the key on receipt.
+type NotifyEvent struct {
+	Time time.Time
+}
+
+var (
+	regNotifyChangeKeyValueP *syscall.Proc
+	createEventP, setEventP  *syscall.Proc
+	waitForSingleObjectExP   *syscall.Proc
+)
+
+func init() {
+	advapi32 := syscall.MustLoadDLL("advapi32.dll")
+	regNotifyChangeKeyValueP = advapi32.MustFindProc("RegNotifyChangeKeyValue")
+
+	kernel32 := syscall.MustLoadDLL("kernel32.dll")
+	createEventP = kernel32.MustFindProc("CreateEventW")
+	setEventP = kernel32.MustFindProc("SetEvent")
+	waitForSingleObjectExP = kernel32.MustFindProc("WaitForSingleObjectEx")
+}
+
+const (
+	waitObject0  = 0
+	waitInfinite = 0xFFFFFFFF
+)
+
+// Notify watches k for changes matching filter and delivers a NotifyEvent
+// on the returned channel for each one, until ctx is canceled, at which
+// point the channel is closed. The returned channel is unbuffered: a slow
+// consumer delays delivery of the next notification but does not drop it.
+func (k RegKey) Notify(ctx context.Context, filter NotifyFilter) (<-chan NotifyEvent, error) {
+	hEvent, _, err := createEventP.Call(0, 0, 0, 0)
+	if hEvent == 0 {
+		return nil, err
+	}
+	event := syscall.Handle(hEvent)
+
+	ch := make(chan NotifyEvent)
+	done := make(chan struct{})
+
+	// watcherDone is released once the watcher goroutine has returned,
+	// which for the ctx.Done() branch means its SetEvent call has
+	// already completed. The worker waits on it before closing event,
+	// so the two goroutines never touch the handle at the same time.
+	var watcherDone sync.WaitGroup
+	watcherDone.Add(1)
+	go func() {
+		defer watcherDone.Done()
+		select {
+		case <-ctx.Done():
+			setEventP.Call(uintptr(event))
+		case <-done:
+		}
+	}()
+
+	go func() {
+		defer close(ch)
+		defer syscall.CloseHandle(event)
+		defer watcherDone.Wait()
+		defer close(done)
+
+		watchFilter := filter.Change | regNotifyThreadAgnostic
+		if err := k.armNotify(event, watchFilter, filter.WatchSubtree); err != nil {
+			return
+		}
+		for {
+			ret, _, _ := waitForSingleObjectExP.Call(uintptr(event), waitInfinite, 0)
+
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			if ret != waitObject0 {
+				return
+			}
+
+			// Re-arm before delivering, so that changes made while the
+			// consumer is slow signal event and yield the next NotifyEvent.
+			if err := k.armNotify(event, watchFilter, filter.WatchSubtree); err != nil {
+				return
+			}
+
+			select {
+			case ch <- NotifyEvent{Time: time.Now()}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (k RegKey) armNotify(event syscall.Handle, filter uint32, watchSubtree bool) error {
+	var bWatchSubtree uintptr
+	if watchSubtree {
+		bWatchSubtree = 1
+	}
+	ret, _, _ := regNotifyChangeKeyValueP.Call(
+		uintptr(k),
+		bWatchSubtree,
+		uintptr(filter),
+		uintptr(event),
+		1, // fAsynchronous
+	)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
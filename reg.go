@@ -8,53 +8,181 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"syscall"
 	"unsafe"
 )
 
 type RegKey syscall.Handle
 
+// ValueInfo describes a single value under a key, as returned by Values.
+type ValueInfo struct {
+	Name string
+	Type uint32
+	Size uint32
+}
+
 var (
-	regEnumValueP, regSetValueExP *syscall.Proc
+	regEnumValueP, regSetValueExP   *syscall.Proc
+	regCreateKeyExP                 *syscall.Proc
+	regDeleteValueP                 *syscall.Proc
+	regDeleteKeyExP, regDeleteTreeP *syscall.Proc
+	expandEnvironmentStringsP       *syscall.Proc
 )
 
 func init() {
-	dll := syscall.MustLoadDLL("advapi32.dll")
-	regEnumValueP = dll.MustFindProc("RegEnumValueW")
-	regSetValueExP = dll.MustFindProc("RegSetValueExW")
+	advapi32 := syscall.MustLoadDLL("advapi32.dll")
+	regEnumValueP = advapi32.MustFindProc("RegEnumValueW")
+	regSetValueExP = advapi32.MustFindProc("RegSetValueExW")
+	regCreateKeyExP = advapi32.MustFindProc("RegCreateKeyExW")
+	regDeleteValueP = advapi32.MustFindProc("RegDeleteValueW")
+	regDeleteKeyExP = advapi32.MustFindProc("RegDeleteKeyExW")
+	regDeleteTreeP = advapi32.MustFindProc("RegDeleteTreeW")
+
+	kernel32 := syscall.MustLoadDLL("kernel32.dll")
+	expandEnvironmentStringsP = kernel32.MustFindProc("ExpandEnvironmentStringsW")
 }
 
-func OpenRegKey(path string, root RegKey) (RegKey, error) {
+// Access rights for OpenRegKey and CreateRegKey, mirroring the predefined
+// masks in golang.org/x/sys/windows/registry.
+const (
+	READ        = syscall.KEY_READ
+	WRITE       = syscall.KEY_WRITE
+	ALL_ACCESS  = 0xf003f
+	WOW64_32KEY = 0x00000200
+	WOW64_64KEY = 0x00000100
+)
+
+// OpenRegKey opens the key at path under root with the given access mask
+// (e.g. reg.READ, reg.WRITE, or reg.ALL_ACCESS, optionally OR'd with
+// reg.WOW64_32KEY/reg.WOW64_64KEY).
+func OpenRegKey(path string, root RegKey, access uint32) (RegKey, error) {
 	var key syscall.Handle
-	ps, _ := syscall.UTF16PtrFromString(path)
-	if err := syscall.RegOpenKeyEx(syscall.Handle(root), ps, 0, syscall.KEY_READ|syscall.KEY_SET_VALUE, &key); err != nil {
-		//if err := syscall.RegOpenKeyEx(syscall.Handle(root), ps, 0, syscall.KEY_READ, &key); err != nil {
+	ps, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return RegKey(0), err
+	}
+	if err := syscall.RegOpenKeyEx(syscall.Handle(root), ps, 0, access, &key); err != nil {
 		return RegKey(0), err
 	}
 
 	return RegKey(key), nil
 }
 
+// OpenRegKeyReadWrite opens path with the read/write access mask OpenRegKey
+// used before it took an explicit access parameter.
+//
+// Deprecated: call OpenRegKey(path, root, reg.READ|syscall.KEY_SET_VALUE) instead.
+func OpenRegKeyReadWrite(path string, root RegKey) (RegKey, error) {
+	return OpenRegKey(path, root, syscall.KEY_READ|syscall.KEY_SET_VALUE)
+}
+
+// CreateRegKey opens the key at path under root, creating it (and any
+// missing intermediate keys) if it does not already exist. It reports
+// whether the key already existed.
+func CreateRegKey(path string, root RegKey, access uint32) (RegKey, bool, error) {
+	ps, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return RegKey(0), false, err
+	}
+	var key syscall.Handle
+	var disposition uint32
+	ret, _, _ := regCreateKeyExP.Call(
+		uintptr(root),
+		uintptr(unsafe.Pointer(ps)),
+		0,
+		0,
+		0,
+		uintptr(access),
+		0,
+		uintptr(unsafe.Pointer(&key)),
+		uintptr(unsafe.Pointer(&disposition)),
+	)
+	if ret != 0 {
+		return RegKey(0), false, syscall.Errno(ret)
+	}
+	const regOpenedExistingKey = 2
+	return RegKey(key), disposition == regOpenedExistingKey, nil
+}
+
+// DeleteValue deletes the value named name from k.
+func (k RegKey) DeleteValue(name string) error {
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := regDeleteValueP.Call(uintptr(k), uintptr(unsafe.Pointer(pname)))
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+// DeleteSubKey deletes the named subkey of k, which must have no subkeys
+// of its own.
+func (k RegKey) DeleteSubKey(name string) error {
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := regDeleteKeyExP.Call(uintptr(k), uintptr(unsafe.Pointer(pname)), 0, 0)
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+// DeleteSubKeyTree deletes the named subkey of k along with all of its
+// subkeys and values.
+func (k RegKey) DeleteSubKeyTree(name string) error {
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	ret, _, _ := regDeleteTreeP.Call(uintptr(k), uintptr(unsafe.Pointer(pname)))
+	if ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
 func (k RegKey) Close() {
 	syscall.RegCloseKey(syscall.Handle(k))
 }
 
-func (k RegKey) SubKeys() []string {
-	var nkeys, nvals uint32
-	if err := syscall.RegQueryInfoKey(syscall.Handle(k), nil, nil, nil, &nkeys, nil, nil, &nvals, nil, nil, nil, nil); err != nil {
-		panic(err)
+// SubKeys returns the names of k's immediate child keys.
+func (k RegKey) SubKeys() ([]string, error) {
+	var nkeys, maxSubKeyLen uint32
+	if err := syscall.RegQueryInfoKey(syscall.Handle(k), nil, nil, nil, &nkeys, &maxSubKeyLen, nil, nil, nil, nil, nil, nil); err != nil {
+		return nil, err
 	}
 
-	var subkeys []string
-	var buf [1 << 10]uint16
+	buf := make([]uint16, maxSubKeyLen+1)
+	subkeys := make([]string, 0, nkeys)
 	for i := uint32(0); i < nkeys; i++ {
-		blen := uint32(len(buf))
-		if err := syscall.RegEnumKeyEx(syscall.Handle(k), i, &buf[0], &blen, nil, nil, nil, nil); err != nil {
-			panic(err)
+		for {
+			blen := uint32(len(buf))
+			err := syscall.RegEnumKeyEx(syscall.Handle(k), i, &buf[0], &blen, nil, nil, nil, nil)
+			if err == syscall.ERROR_MORE_DATA {
+				buf = make([]uint16, len(buf)*2)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			subkeys = append(subkeys, syscall.UTF16ToString(buf[:blen]))
+			break
 		}
-		k := syscall.UTF16ToString(buf[:])
-		subkeys = append(subkeys, k)
+	}
+	return subkeys, nil
+}
+
+// MustSubKeys is the pre-error-returning form of SubKeys.
+//
+// Deprecated: use SubKeys, which reports errors instead of panicking.
+func (k RegKey) MustSubKeys() []string {
+	subkeys, err := k.SubKeys()
+	if err != nil {
+		panic(err)
 	}
 	return subkeys
 }
@@ -76,24 +204,31 @@ func (k RegKey) DWordValue(key string) (uint32, error) {
 }
 
 func (k RegKey) SetDWordValue(name string, val uint32) error {
-	uname, _ := syscall.UTF16PtrFromString(name)
-	buf := new(bytes.Buffer)
-	if err := binary.Write(buf, binary.LittleEndian, val); err != nil {
-		return err
-	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], val)
+	return k.setValue(name, syscall.REG_DWORD, buf[:])
+}
 
-	if ret, _, _ := regSetValueExP.Call(
-		uintptr(k),
-		uintptr(unsafe.Pointer(uname)),
-		0,
-		uintptr(syscall.REG_DWORD),
-		uintptr(unsafe.Pointer(&buf.Bytes()[0])),
-		uintptr(buf.Len()),
-	); ret != 0 {
-		return fmt.Errorf("SetDWordValue error: %d", ret)
+func (k RegKey) QWordValue(key string) (uint64, error) {
+	d, typ, err := k.regValue(key)
+	if err != nil {
+		return 0, err
+	}
+	if typ != syscall.REG_QWORD {
+		return 0, fmt.Errorf("Registry key not a QWORD")
 	}
+	var val uint64
+	buf := bytes.NewReader(d)
+	if err := binary.Read(buf, binary.LittleEndian, &val); err != nil {
+		return 0, err
+	}
+	return val, nil
+}
 
-	return nil
+func (k RegKey) SetQWordValue(name string, val uint64) error {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], val)
+	return k.setValue(name, syscall.REG_QWORD, buf[:])
 }
 
 func (k RegKey) BoolValue(key string) (bool, error) {
@@ -119,35 +254,199 @@ func (k RegKey) StringValue(key string) (string, error) {
 	if t != syscall.REG_SZ {
 		return "", fmt.Errorf("Registry key not a string")
 	}
-	buf := (*[1 << 10]uint16)(unsafe.Pointer(&d[0]))[:]
+	return syscall.UTF16ToString(utf16SliceFromBytes(d)), nil
+}
+
+// ExpandStringValue returns the REG_EXPAND_SZ value named key, with any
+// embedded environment-variable references (e.g. "%SystemRoot%") expanded.
+func (k RegKey) ExpandStringValue(key string) (string, error) {
+	d, t, err := k.regValue(key)
+	if err != nil {
+		return "", err
+	}
+	if t != syscall.REG_EXPAND_SZ {
+		return "", fmt.Errorf("Registry key not an expandable string")
+	}
+	raw := utf16SliceFromBytes(d)
+	return expandEnvironmentStrings(syscall.UTF16ToString(raw))
+}
+
+func (k RegKey) SetExpandStringValue(name, value string) error {
+	uvalue, err := syscall.UTF16FromString(value)
+	if err != nil {
+		return err
+	}
+	return k.setValue(name, syscall.REG_EXPAND_SZ, utf16BytesFromSlice(uvalue))
+}
+
+// StringsValue returns the REG_MULTI_SZ value named key as a slice of strings.
+func (k RegKey) StringsValue(key string) ([]string, error) {
+	d, t, err := k.regValue(key)
+	if err != nil {
+		return nil, err
+	}
+	if t != syscall.REG_MULTI_SZ {
+		return nil, fmt.Errorf("Registry key not a multi-string")
+	}
+	return parseMultiString(utf16SliceFromBytes(d)), nil
+}
+
+func (k RegKey) SetStringsValue(name string, values []string) error {
+	return k.setValue(name, syscall.REG_MULTI_SZ, utf16BytesFromSlice(buildMultiString(values)))
+}
+
+// BinaryValue returns the REG_BINARY value named key.
+func (k RegKey) BinaryValue(key string) ([]byte, error) {
+	d, t, err := k.regValue(key)
+	if err != nil {
+		return nil, err
+	}
+	if t != syscall.REG_BINARY {
+		return nil, fmt.Errorf("Registry key not binary")
+	}
+	return d, nil
+}
+
+func (k RegKey) SetBinaryValue(name string, value []byte) error {
+	return k.setValue(name, syscall.REG_BINARY, value)
+}
+
+// setValue writes data of the given registry type to the value named name.
+func (k RegKey) setValue(name string, typ uint32, data []byte) error {
+	uname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var dataPtr *byte
+	if len(data) > 0 {
+		dataPtr = &data[0]
+	}
+	if ret, _, _ := regSetValueExP.Call(
+		uintptr(k),
+		uintptr(unsafe.Pointer(uname)),
+		0,
+		uintptr(typ),
+		uintptr(unsafe.Pointer(dataPtr)),
+		uintptr(len(data)),
+	); ret != 0 {
+		return syscall.Errno(ret)
+	}
+	return nil
+}
+
+// expandEnvironmentStrings expands environment-variable references in s
+// (e.g. "%SystemRoot%") via the Windows ExpandEnvironmentStringsW API.
+func expandEnvironmentStrings(s string) (string, error) {
+	us, err := syscall.UTF16PtrFromString(s)
+	if err != nil {
+		return "", err
+	}
+	n, _, _ := expandEnvironmentStringsP.Call(uintptr(unsafe.Pointer(us)), 0, 0)
+	if n == 0 {
+		return "", fmt.Errorf("ExpandEnvironmentStrings error: %d", syscall.GetLastError())
+	}
+	buf := make([]uint16, n)
+	n, _, _ = expandEnvironmentStringsP.Call(uintptr(unsafe.Pointer(us)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if n == 0 {
+		return "", fmt.Errorf("ExpandEnvironmentStrings error: %d", syscall.GetLastError())
+	}
 	return syscall.UTF16ToString(buf), nil
 }
 
-func (k RegKey) Values() map[string]string {
-	var nkeys, nvals uint32
-	if err := syscall.RegQueryInfoKey(syscall.Handle(k), nil, nil, nil, &nkeys, nil, nil, &nvals, nil, nil, nil, nil); err != nil {
-		log.Fatal(err)
+// utf16SliceFromBytes reinterprets a little-endian UTF-16 byte buffer as a
+// uint16 slice.
+func utf16SliceFromBytes(b []byte) []uint16 {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
 	}
+	return u
+}
 
-	var values = make(map[string]string, nvals)
-	var buf [1 << 10]uint16
-	var data [1 << 10]byte
-	for i := uint32(0); i < nvals; i++ {
-		var typ uint32
-		blen := uint32(len(buf))
-		dlen := uint32(len(data))
-		if err := myRegEnumValue(syscall.Handle(k), i, &buf[0], &blen, &typ, &data[0], &dlen); err != nil {
-			panic(err)
+// utf16BytesFromSlice encodes a uint16 slice as little-endian bytes.
+func utf16BytesFromSlice(u []uint16) []byte {
+	b := make([]byte, len(u)*2)
+	for i, v := range u {
+		b[2*i] = byte(v)
+		b[2*i+1] = byte(v >> 8)
+	}
+	return b
+}
+
+// parseMultiString splits a double-NUL terminated REG_MULTI_SZ buffer into
+// its component strings.
+func parseMultiString(u []uint16) []string {
+	var ss []string
+	for len(u) > 0 {
+		end := 0
+		for end < len(u) && u[end] != 0 {
+			end++
+		}
+		if end == 0 {
+			break
 		}
-		valName := syscall.UTF16ToString(buf[:blen])
-		switch typ {
-		case syscall.REG_SZ:
-			values[valName] = "string"
-		case syscall.REG_DWORD:
-			values[valName] = "uint32"
-		case syscall.REG_BINARY:
-			values[valName] = "binary"
+		ss = append(ss, syscall.UTF16ToString(u[:end]))
+		if end+1 >= len(u) {
+			break
 		}
+		u = u[end+1:]
+	}
+	return ss
+}
+
+// buildMultiString encodes a slice of strings as a double-NUL terminated
+// REG_MULTI_SZ buffer.
+func buildMultiString(ss []string) []uint16 {
+	var u []uint16
+	for _, s := range ss {
+		u = append(u, syscall.StringToUTF16(s)...)
+	}
+	u = append(u, 0)
+	return u
+}
+
+// Values returns the name, type and size of every value under k.
+func (k RegKey) Values() ([]ValueInfo, error) {
+	var nvals, maxValueNameLen, maxValueLen uint32
+	if err := syscall.RegQueryInfoKey(syscall.Handle(k), nil, nil, nil, nil, nil, nil, &nvals, &maxValueNameLen, &maxValueLen, nil, nil); err != nil {
+		return nil, err
+	}
+
+	nameBuf := make([]uint16, maxValueNameLen+1)
+	dataBuf := make([]byte, maxValueLen+1)
+	values := make([]ValueInfo, 0, nvals)
+	for i := uint32(0); i < nvals; i++ {
+		for {
+			var typ uint32
+			nlen := uint32(len(nameBuf))
+			dlen := uint32(len(dataBuf))
+			err := myRegEnumValue(syscall.Handle(k), i, &nameBuf[0], &nlen, &typ, &dataBuf[0], &dlen)
+			if err == syscall.ERROR_MORE_DATA {
+				nameBuf = make([]uint16, len(nameBuf)*2)
+				dataBuf = make([]byte, len(dataBuf)*2)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, ValueInfo{
+				Name: syscall.UTF16ToString(nameBuf[:nlen]),
+				Type: typ,
+				Size: dlen,
+			})
+			break
+		}
+	}
+	return values, nil
+}
+
+// MustValues is the pre-error-returning form of Values.
+//
+// Deprecated: use Values, which reports errors instead of panicking.
+func (k RegKey) MustValues() []ValueInfo {
+	values, err := k.Values()
+	if err != nil {
+		panic(err)
 	}
 	return values
 }
@@ -155,12 +454,18 @@ func (k RegKey) Values() map[string]string {
 func (k RegKey) regValue(key string) ([]byte, uint32, error) {
 	kname, _ := syscall.UTF16PtrFromString(key)
 	var typ uint32
-	var data [1 << 10]byte
-	dlen := uint32(len(data))
-	if err := syscall.RegQueryValueEx(syscall.Handle(k), kname, nil, &typ, &data[0], &dlen); err != nil {
-		return nil, 0, err
+	dlen := uint32(1 << 10)
+	for {
+		data := make([]byte, dlen)
+		err := syscall.RegQueryValueEx(syscall.Handle(k), kname, nil, &typ, &data[0], &dlen)
+		if err == syscall.ERROR_MORE_DATA {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return data[:dlen], typ, nil
 	}
-	return data[:dlen], typ, nil
 }
 
 func myRegEnumValue(hKey syscall.Handle, index uint32, lpValueName *uint16, lpcchValueName *uint32, lpType *uint32, lpData *byte, lpcbData *uint32) error {
@@ -0,0 +1,39 @@
+package reg
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var regConnectRegistryP *syscall.Proc
+
+func init() {
+	advapi32 := syscall.MustLoadDLL("advapi32.dll")
+	regConnectRegistryP = advapi32.MustFindProc("RegConnectRegistryW")
+}
+
+// ConnectRegistry opens root on a remote machine, named in UNC form
+// (e.g. `\\server`) or by hostname. Windows only allows HKEY_LOCAL_MACHINE
+// and HKEY_USERS to be used as root for a remote connection; any other
+// predefined key is rejected by the remote registry service.
+//
+// The returned RegKey can be passed as root to OpenRegKey, and its
+// SubKeys, Values and typed value accessors work exactly as they do for a
+// local key. Call Close on it when done; Close's RegCloseKey also tears
+// down the remote connection.
+func ConnectRegistry(machine string, root RegKey) (RegKey, error) {
+	pmachine, err := syscall.UTF16PtrFromString(machine)
+	if err != nil {
+		return RegKey(0), err
+	}
+	var key syscall.Handle
+	ret, _, _ := regConnectRegistryP.Call(
+		uintptr(unsafe.Pointer(pmachine)),
+		uintptr(root),
+		uintptr(unsafe.Pointer(&key)),
+	)
+	if ret != 0 {
+		return RegKey(0), syscall.Errno(ret)
+	}
+	return RegKey(key), nil
+}
@@ -0,0 +1,157 @@
+package reg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// Walk recursively enumerates every subkey and every value under k, calling
+// fn once per value with the key path relative to k (empty for k itself),
+// the value name, its registry type, and its raw data. The registry tree
+// has no cycles, so no visited-set is needed.
+//
+// Each subkey is opened with KEY_READ only and closed before Walk returns
+// from that branch. Subkeys the caller lacks permission to open are skipped
+// rather than aborting the whole walk.
+func (k RegKey) Walk(fn func(path string, name string, typ uint32, data []byte) error) error {
+	return walkKey(k, "", fn)
+}
+
+func walkKey(k RegKey, path string, fn func(string, string, uint32, []byte) error) error {
+	var nkeys, nvals, maxSubKeyLen, maxValueNameLen, maxValueLen uint32
+	if err := syscall.RegQueryInfoKey(syscall.Handle(k), nil, nil, nil, &nkeys, &maxSubKeyLen, nil, &nvals, &maxValueNameLen, &maxValueLen, nil, nil); err != nil {
+		return err
+	}
+
+	maxNameLen := maxSubKeyLen
+	if maxValueNameLen > maxNameLen {
+		maxNameLen = maxValueNameLen
+	}
+	nameBuf := make([]uint16, maxNameLen+1)
+	dataBuf := make([]byte, maxValueLen+1)
+	for i := uint32(0); i < nvals; i++ {
+		for {
+			var typ uint32
+			nlen := uint32(len(nameBuf))
+			dlen := uint32(len(dataBuf))
+			err := myRegEnumValue(syscall.Handle(k), i, &nameBuf[0], &nlen, &typ, &dataBuf[0], &dlen)
+			if err == syscall.ERROR_MORE_DATA {
+				nameBuf = make([]uint16, len(nameBuf)*2)
+				dataBuf = make([]byte, len(dataBuf)*2)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(path, syscall.UTF16ToString(nameBuf[:nlen]), typ, dataBuf[:dlen]); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	for i := uint32(0); i < nkeys; i++ {
+		var name string
+		for {
+			nlen := uint32(len(nameBuf))
+			err := syscall.RegEnumKeyEx(syscall.Handle(k), i, &nameBuf[0], &nlen, nil, nil, nil, nil)
+			if err == syscall.ERROR_MORE_DATA {
+				nameBuf = make([]uint16, len(nameBuf)*2)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			name = syscall.UTF16ToString(nameBuf[:nlen])
+			break
+		}
+
+		child, err := openChildForRead(k, name)
+		if err == syscall.ERROR_ACCESS_DENIED {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		childPath := name
+		if path != "" {
+			childPath = path + `\` + name
+		}
+		err = walkKey(child, childPath, fn)
+		child.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func openChildForRead(parent RegKey, name string) (RegKey, error) {
+	pname, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return RegKey(0), err
+	}
+	var key syscall.Handle
+	if err := syscall.RegOpenKeyEx(syscall.Handle(parent), pname, 0, syscall.KEY_READ, &key); err != nil {
+		return RegKey(0), err
+	}
+	return RegKey(key), nil
+}
+
+// DumpSubtree writes a stable, human-readable listing of every value under
+// k to w, one line per value giving its key path, name, type and decoded
+// value; keys that hold no values do not appear. It is intended for inclusion
+// in bug-report logs, e.g. alongside Tailscale-style support info dumps.
+func (k RegKey) DumpSubtree(w io.Writer) error {
+	return k.Walk(func(path, name string, typ uint32, data []byte) error {
+		full := name
+		if path != "" {
+			full = path + `\` + name
+		}
+		_, err := fmt.Fprintf(w, "%s = %s: %s\n", full, regTypeName(typ), decodeForDump(typ, data))
+		return err
+	})
+}
+
+func regTypeName(typ uint32) string {
+	switch typ {
+	case syscall.REG_SZ:
+		return "REG_SZ"
+	case syscall.REG_EXPAND_SZ:
+		return "REG_EXPAND_SZ"
+	case syscall.REG_MULTI_SZ:
+		return "REG_MULTI_SZ"
+	case syscall.REG_DWORD:
+		return "REG_DWORD"
+	case syscall.REG_QWORD:
+		return "REG_QWORD"
+	case syscall.REG_BINARY:
+		return "REG_BINARY"
+	default:
+		return fmt.Sprintf("REG_UNKNOWN(%d)", typ)
+	}
+}
+
+func decodeForDump(typ uint32, data []byte) string {
+	switch typ {
+	case syscall.REG_SZ, syscall.REG_EXPAND_SZ:
+		return syscall.UTF16ToString(utf16SliceFromBytes(data))
+	case syscall.REG_MULTI_SZ:
+		return fmt.Sprintf("%q", parseMultiString(utf16SliceFromBytes(data)))
+	case syscall.REG_DWORD:
+		if len(data) < 4 {
+			return hex.EncodeToString(data)
+		}
+		return fmt.Sprintf("%d", binary.LittleEndian.Uint32(data))
+	case syscall.REG_QWORD:
+		if len(data) < 8 {
+			return hex.EncodeToString(data)
+		}
+		return fmt.Sprintf("%d", binary.LittleEndian.Uint64(data))
+	default:
+		return hex.EncodeToString(data)
+	}
+}